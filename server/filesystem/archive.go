@@ -0,0 +1,406 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"emperror.dev/errors"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/pterodactyl/wings/internal/ufs"
+)
+
+// spillThreshold is the size, in bytes, past which a parallel worker spills a
+// file's contents to a temporary file instead of buffering them in memory.
+// This bounds per-worker memory use when Concurrency is greater than one and
+// the archive contains large files; small files (the common case) never
+// touch disk twice.
+const spillThreshold = 32 * 1024 * 1024
+
+// Archive represents a request to create a compressed archive (a tarball or
+// a zip, depending on Format) of a set of files within a server's data
+// directory.
+type Archive struct {
+	// Filesystem is the server filesystem the archive is being created
+	// against.
+	Filesystem *Filesystem
+	// BaseDirectory is the server-relative directory that Files are resolved
+	// against. All paths written into the archive are relative to this
+	// directory.
+	BaseDirectory string
+	// Files is an allow-list of files and directories, relative to
+	// BaseDirectory, that should be included in the archive. If empty, the
+	// entire BaseDirectory is archived.
+	Files []string
+	// Exclude is a list of gitignore/.pteroignore-style glob patterns,
+	// relative to BaseDirectory, for files and directories that should be
+	// skipped even though they matched Files (or because Files was empty
+	// and the whole directory is being walked).
+	Exclude []string
+
+	// Concurrency is the number of worker goroutines used to read files
+	// from disk in parallel while building the archive. If one or less,
+	// files are read serially on the calling goroutine.
+	Concurrency int
+	// BufferCapacity is the number of entries buffered between the producer,
+	// workers, and serializer. Defaults to Concurrency when unset.
+	BufferCapacity int
+	// ChunkSize is the read buffer size, in bytes, used by each worker when
+	// copying a file's contents. Defaults to 4 KiB. Files larger than
+	// spillThreshold are read into a temporary file instead of memory
+	// regardless of ChunkSize; see entry.spillPath.
+	ChunkSize int
+
+	// Format selects the container/compression the archive is written as.
+	// The zero value is FormatTarGz.
+	Format Format
+	// CompressionLevel is passed through to the underlying compressor. Its
+	// meaning (and valid range) depends on Format; for FormatZip the zero
+	// value means no compression (store), same as the underlying flate
+	// constants, not "pick the compressor's default" - ask for
+	// flate.DefaultCompression explicitly for that. For FormatTarGz the
+	// value goes to archives.Gzip, which treats zero as gzip's default
+	// level. FormatTarXz and FormatTarBz2 ignore this field entirely,
+	// since neither underlying library exposes a level to set.
+	CompressionLevel int
+
+	// SplitSize, if greater than zero, is the maximum number of bytes
+	// written to a single archive part before rolling over to the next one.
+	// Stream itself is agnostic to splitting; it is the caller's
+	// responsibility (see CompressFiles) to hand Stream a splitWriter when
+	// SplitSize is set.
+	SplitSize int64
+}
+
+// entry is a single file or directory queued for inclusion in the archive.
+// It is produced by the walker in discovery order and, for regular files,
+// populated by a worker goroutine. ready is closed once buf/spillPath (if
+// any) is safe to read, letting the serializer consume entries in enqueue
+// order no matter which worker finished first.
+type entry struct {
+	relative string
+	info     ufs.FileInfo
+	// buf holds the file's contents when they stayed under spillThreshold.
+	// spillPath names a temporary file holding the contents instead, when
+	// they didn't; at most one of the two is set for a regular file, and
+	// neither is for an empty one.
+	buf       []byte
+	spillPath string
+	ready     chan struct{}
+}
+
+// Create creates the archive at the given destination path on the host
+// machine and streams the configured files into it.
+func (a *Archive) Create(ctx context.Context, dest string) error {
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return a.Stream(ctx, f)
+}
+
+// Stream writes an archive of the configured files, in Format, into w. When
+// Concurrency is greater than one, files are read from disk concurrently by
+// a pool of workers while a single serializer goroutine writes completed
+// entries to w in the order they were discovered, so the resulting archive
+// is deterministic regardless of how many workers are used.
+func (a *Archive) Stream(ctx context.Context, w io.Writer) error {
+	if a.Concurrency > 1 {
+		return a.streamParallel(ctx, w)
+	}
+	return a.streamSerial(ctx, w)
+}
+
+// streamSerial walks the configured files and writes each one directly to
+// the archive writer as it is discovered. This is the historical behavior
+// and remains the default: Stream uses it whenever Concurrency is one or
+// less, whatever the size of the archive.
+func (a *Archive) streamSerial(ctx context.Context, w io.Writer) error {
+	aw, err := a.newArchiveWriter(w)
+	if err != nil {
+		return err
+	}
+	defer aw.Close()
+
+	return a.walk(ctx, func(relative string, info ufs.FileInfo, f ufs.File) error {
+		dst, err := aw.WriteHeader(relative, info)
+		if err != nil {
+			return err
+		}
+		if f == nil {
+			return nil
+		}
+		_, err = io.Copy(dst, f)
+		return err
+	})
+}
+
+// streamParallel runs a producer/worker-pool/serializer pipeline: the
+// producer walks the tree and enqueues an entry per file or directory, a
+// pool of workers reads each file's contents (into memory, or to a
+// temporary file past spillThreshold; see readSpillable), and a single
+// serializer goroutine writes finished entries to the archive writer in the
+// order they were enqueued so offsets within the archive remain stable. All
+// writes flow through w, which callers are expected to have wrapped in a
+// ufs.CountedWriter so disk-quota accounting keeps working.
+func (a *Archive) streamParallel(ctx context.Context, w io.Writer) error {
+	concurrency := a.Concurrency
+	if concurrency < 1 {
+		concurrency = runtime.NumCPU()
+	}
+	bufferCapacity := a.BufferCapacity
+	if bufferCapacity < 1 {
+		bufferCapacity = concurrency
+	}
+	chunk := a.ChunkSize
+	if chunk < 1 {
+		chunk = 4096
+	}
+
+	aw, err := a.newArchiveWriter(w)
+	if err != nil {
+		return err
+	}
+	defer aw.Close()
+
+	// spilled tracks temporary files created by workers that the serializer
+	// hasn't consumed (and removed) yet, so that an error or cancellation
+	// partway through the pipeline doesn't leak them.
+	var spillMu sync.Mutex
+	spilled := make(map[string]struct{})
+	trackSpill := func(path string) {
+		spillMu.Lock()
+		spilled[path] = struct{}{}
+		spillMu.Unlock()
+	}
+	untrackSpill := func(path string) {
+		spillMu.Lock()
+		delete(spilled, path)
+		spillMu.Unlock()
+		_ = os.Remove(path)
+	}
+	defer func() {
+		spillMu.Lock()
+		defer spillMu.Unlock()
+		for path := range spilled {
+			_ = os.Remove(path)
+		}
+	}()
+
+	eg, ctx := errgroup.WithContext(ctx)
+
+	toRead := make(chan *entry, bufferCapacity)
+	toWrite := make(chan *entry, bufferCapacity)
+
+	// Producer: walk the tree in order, handing each entry to the
+	// serializer queue immediately and, for regular files, to the worker
+	// queue so its contents can be read in the background.
+	eg.Go(func() error {
+		defer close(toRead)
+		defer close(toWrite)
+		return a.walk(ctx, func(relative string, info ufs.FileInfo, f ufs.File) error {
+			e := &entry{relative: relative, info: info, ready: make(chan struct{})}
+			if f == nil {
+				close(e.ready)
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case toWrite <- e:
+			}
+			if f != nil {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case toRead <- e:
+				}
+			}
+			return nil
+		})
+	})
+
+	// Workers: read each file's contents and signal completion. Files past
+	// spillThreshold are spilled to a temporary file instead of kept in
+	// memory, bounding resident memory when many large files are being read
+	// concurrently.
+	for i := 0; i < concurrency; i++ {
+		eg.Go(func() error {
+			for e := range toRead {
+				f, err := a.Filesystem.unixFS.Open(filepath.Join(a.BaseDirectory, e.relative))
+				if err != nil {
+					return err
+				}
+				buf, spillPath, err := readSpillable(f, chunk)
+				_ = f.Close()
+				if err != nil {
+					if spillPath != "" {
+						_ = os.Remove(spillPath)
+					}
+					return err
+				}
+				if spillPath != "" {
+					trackSpill(spillPath)
+				}
+				e.buf = buf
+				e.spillPath = spillPath
+				close(e.ready)
+			}
+			return nil
+		})
+	}
+
+	// Serializer: the only goroutine allowed to touch aw, guaranteeing
+	// entries land in the archive in enqueue order.
+	eg.Go(func() error {
+		for e := range toWrite {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-e.ready:
+			}
+			dst, err := aw.WriteHeader(e.relative, e.info)
+			if err != nil {
+				return err
+			}
+			if e.spillPath != "" {
+				err := copySpillFile(dst, e.spillPath)
+				untrackSpill(e.spillPath)
+				if err != nil {
+					return err
+				}
+			} else if e.buf != nil {
+				if _, err := dst.Write(e.buf); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+
+	return eg.Wait()
+}
+
+// readSpillable reads r to completion using chunk-sized reads, returning its
+// contents in buf while they stay under spillThreshold. Once that threshold
+// is crossed, the data read so far (and everything after) is written to a
+// temporary file instead, and spillPath names that file, seeked back to the
+// start and ready to read; the caller is responsible for removing it once
+// its contents have been copied into the archive. At most one of buf and
+// spillPath is non-empty on success; both are empty when r is empty.
+func readSpillable(r io.Reader, chunk int) (buf []byte, spillPath string, err error) {
+	var mem bytes.Buffer
+	var tmp *os.File
+	b := make([]byte, chunk)
+	for {
+		n, rerr := r.Read(b)
+		if n > 0 {
+			if tmp != nil {
+				if _, werr := tmp.Write(b[:n]); werr != nil {
+					_ = tmp.Close()
+					return nil, tmp.Name(), werr
+				}
+			} else {
+				mem.Write(b[:n])
+				if mem.Len() > spillThreshold {
+					tmp, err = os.CreateTemp("", "wings-archive-*")
+					if err != nil {
+						return nil, "", err
+					}
+					if _, werr := tmp.Write(mem.Bytes()); werr != nil {
+						_ = tmp.Close()
+						return nil, tmp.Name(), werr
+					}
+					mem.Reset()
+				}
+			}
+		}
+		if rerr != nil {
+			if rerr == io.EOF {
+				break
+			}
+			if tmp != nil {
+				_ = tmp.Close()
+				return nil, tmp.Name(), rerr
+			}
+			return nil, "", rerr
+		}
+	}
+	if tmp == nil {
+		return mem.Bytes(), "", nil
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		_ = tmp.Close()
+		return nil, tmp.Name(), err
+	}
+	path := tmp.Name()
+	if err := tmp.Close(); err != nil {
+		return nil, path, err
+	}
+	return nil, path, nil
+}
+
+// copySpillFile copies the contents of the temporary file at path into dst.
+func copySpillFile(dst io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(dst, f)
+	return err
+}
+
+// walk resolves Files against BaseDirectory (or the whole directory when
+// Files is empty) and invokes fn once per discovered entry, in the order the
+// underlying filesystem returns them. fn receives a nil ufs.File for
+// directories.
+func (a *Archive) walk(ctx context.Context, fn func(relative string, info ufs.FileInfo, f ufs.File) error) error {
+	paths := a.Files
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	allowed, err := compileMatcher(nil, a.Exclude)
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		root := filepath.Join(a.BaseDirectory, p)
+		err := a.Filesystem.unixFS.Walk(root, func(p string, info ufs.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
+			}
+			relative := strings.TrimPrefix(strings.TrimPrefix(p, a.BaseDirectory), "/")
+			if !allowed(relative) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info.IsDir() {
+				return fn(relative, info, nil)
+			}
+			f, err := a.Filesystem.unixFS.Open(p)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return fn(relative, info, f)
+		})
+		if err != nil {
+			return errors.WithStackIf(err)
+		}
+	}
+	return nil
+}
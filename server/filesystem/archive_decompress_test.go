@@ -0,0 +1,142 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/franela/goblin"
+)
+
+func TestDecompressFile(t *testing.T) {
+	g := Goblin(t)
+	fs, rfs := NewFs()
+
+	g.Describe("DecompressFile", func() {
+		g.AfterEach(func() {
+			_ = fs.TruncateRootDirectory()
+		})
+
+		g.It("extracts a small resumable archive and reports progress, without Close erroring on a sidecar that was never flushed", func() {
+			g.Assert(fs.CreateDirectory("src", "/")).IsNil()
+			content := "hello, world!\n"
+			r := strings.NewReader(content)
+			g.Assert(fs.Write("src/file.txt", r, r.Size(), 0o644)).IsNil()
+
+			a := &Archive{Filesystem: fs, Files: []string{"src"}}
+			archivePath := filepath.Join(rfs.root, "archive.tar.gz")
+			g.Assert(a.Create(context.Background(), archivePath)).IsNil()
+
+			// Remove the original so extraction is the only thing that can
+			// put it back.
+			g.Assert(fs.unixFS.Remove(filepath.Join("/", "src/file.txt"))).IsNil()
+
+			var progressed []Progress
+			err := fs.DecompressFile(context.Background(), "/", "archive.tar.gz", DecompressOptions{
+				Resume: true,
+				OnProgress: func(p Progress) {
+					progressed = append(progressed, p)
+				},
+			})
+			// A single-entry archive is well under sessionCheckpointEntries
+			// and finishes well under sessionCheckpointInterval, so the
+			// sidecar is never flushed to disk; Close must not surface that
+			// as a failure.
+			g.Assert(err).IsNil()
+
+			info, err := fs.unixFS.Stat(filepath.Join("/", "src/file.txt"))
+			g.Assert(err).IsNil()
+			g.Assert(info.Size()).Equal(int64(len(content)))
+
+			g.Assert(len(progressed)).Equal(1)
+			g.Assert(progressed[0].BytesWritten).Equal(int64(len(content)))
+			g.Assert(progressed[0].FilesDone).Equal(1)
+		})
+
+		g.It("honors Exclude during extraction", func() {
+			g.Assert(fs.CreateDirectory("src", "/")).IsNil()
+			r := strings.NewReader("keep\n")
+			g.Assert(fs.Write("src/keep.txt", r, r.Size(), 0o644)).IsNil()
+			r = strings.NewReader("skip\n")
+			g.Assert(fs.Write("src/skip.log", r, r.Size(), 0o644)).IsNil()
+
+			a := &Archive{Filesystem: fs, Files: []string{"src"}}
+			archivePath := filepath.Join(rfs.root, "archive.tar.gz")
+			g.Assert(a.Create(context.Background(), archivePath)).IsNil()
+
+			g.Assert(fs.unixFS.Remove(filepath.Join("/", "src/keep.txt"))).IsNil()
+			g.Assert(fs.unixFS.Remove(filepath.Join("/", "src/skip.log"))).IsNil()
+
+			err := fs.DecompressFile(context.Background(), "/", "archive.tar.gz", DecompressOptions{
+				Exclude: []string{"*.log"},
+			})
+			g.Assert(err).IsNil()
+
+			_, err = fs.unixFS.Stat(filepath.Join("/", "src/keep.txt"))
+			g.Assert(err).IsNil()
+			_, err = fs.unixFS.Stat(filepath.Join("/", "src/skip.log"))
+			g.Assert(err).IsNotNil()
+		})
+
+		g.It("honors Include during extraction", func() {
+			g.Assert(fs.CreateDirectory("src", "/")).IsNil()
+			r := strings.NewReader("keep\n")
+			g.Assert(fs.Write("src/a/keep.txt", r, r.Size(), 0o644)).IsNil()
+			r = strings.NewReader("skip\n")
+			g.Assert(fs.Write("src/b/skip.txt", r, r.Size(), 0o644)).IsNil()
+
+			a := &Archive{Filesystem: fs, Files: []string{"src"}}
+			archivePath := filepath.Join(rfs.root, "archive.tar.gz")
+			g.Assert(a.Create(context.Background(), archivePath)).IsNil()
+
+			g.Assert(fs.unixFS.Remove(filepath.Join("/", "src/a/keep.txt"))).IsNil()
+			g.Assert(fs.unixFS.Remove(filepath.Join("/", "src/b/skip.txt"))).IsNil()
+
+			err := fs.DecompressFile(context.Background(), "/", "archive.tar.gz", DecompressOptions{
+				Include: []string{"src/a"},
+			})
+			g.Assert(err).IsNil()
+
+			_, err = fs.unixFS.Stat(filepath.Join("/", "src/a/keep.txt"))
+			g.Assert(err).IsNil()
+			_, err = fs.unixFS.Stat(filepath.Join("/", "src/b/skip.txt"))
+			g.Assert(err).IsNotNil()
+		})
+	})
+}
+
+func TestExtractStreamUnsafe(t *testing.T) {
+	g := Goblin(t)
+	fs, rfs := NewFs()
+
+	g.Describe("ExtractStreamUnsafe", func() {
+		g.AfterEach(func() {
+			_ = fs.TruncateRootDirectory()
+		})
+
+		g.It("extracts an archive read directly from a stream", func() {
+			g.Assert(fs.CreateDirectory("src", "/")).IsNil()
+			content := "hello, world!\n"
+			r := strings.NewReader(content)
+			g.Assert(fs.Write("src/file.txt", r, r.Size(), 0o644)).IsNil()
+
+			a := &Archive{Filesystem: fs, Files: []string{"src"}}
+			archivePath := filepath.Join(rfs.root, "archive.tar.gz")
+			g.Assert(a.Create(context.Background(), archivePath)).IsNil()
+
+			g.Assert(fs.unixFS.Remove(filepath.Join("/", "src/file.txt"))).IsNil()
+
+			raw, err := os.ReadFile(archivePath)
+			g.Assert(err).IsNil()
+
+			g.Assert(fs.ExtractStreamUnsafe(context.Background(), "/", bytes.NewReader(raw))).IsNil()
+
+			info, err := fs.unixFS.Stat(filepath.Join("/", "src/file.txt"))
+			g.Assert(err).IsNil()
+			g.Assert(info.Size()).Equal(int64(len(content)))
+		})
+	})
+}
@@ -0,0 +1,164 @@
+package filesystem
+
+import (
+	"archive/tar"
+	"compress/flate"
+	"io"
+
+	"github.com/klauspost/compress/zip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/mholt/archives"
+
+	"github.com/pterodactyl/wings/internal/ufs"
+)
+
+// Format identifies the container/compression combination an Archive should
+// be written as.
+type Format string
+
+const (
+	// FormatTarGz is a gzip-compressed tarball. This is the default format
+	// and matches the historical behavior of CompressFiles.
+	FormatTarGz Format = "tar.gz"
+	// FormatZip is a standard zip archive.
+	FormatZip Format = "zip"
+	// FormatTarZstd is a zstd-compressed tarball, generally both smaller and
+	// faster than gzip for the kind of data found in game server backups.
+	FormatTarZstd Format = "tar.zst"
+	// FormatTarXz is an xz-compressed tarball.
+	FormatTarXz Format = "tar.xz"
+	// FormatTarBz2 is a bzip2-compressed tarball.
+	FormatTarBz2 Format = "tar.bz2"
+)
+
+// Extension returns the file extension (without a leading dot) that should
+// be used for a file written in this format. An empty Format is treated as
+// FormatTarGz.
+func (f Format) Extension() string {
+	if f == "" {
+		return string(FormatTarGz)
+	}
+	return string(f)
+}
+
+// archiveWriter abstracts over the concrete tar or zip writer backing an
+// Archive.Stream call so the walking and pipeline logic in archive.go
+// doesn't need to know which on-disk format is being produced.
+type archiveWriter interface {
+	// WriteHeader records relative and info as the next entry in the
+	// archive and returns the io.Writer its contents, if any, should be
+	// copied into.
+	WriteHeader(relative string, info ufs.FileInfo) (io.Writer, error)
+	Close() error
+}
+
+// newArchiveWriter builds the archiveWriter for the given format, wrapping w
+// with whichever compressor the format requires.
+func (a *Archive) newArchiveWriter(w io.Writer) (archiveWriter, error) {
+	if a.Format == FormatZip {
+		zw := zip.NewWriter(w)
+		// CompressionLevel passes straight through to flate, unlike the
+		// tar-based formats, where compressor() may translate it (zstd) or
+		// drop it (xz, bzip2). In particular the zero value means flate.NoCompression
+		// (store), not "pick flate's own default" - callers that want
+		// flate's default level need to ask for flate.DefaultCompression
+		// explicitly.
+		level := a.CompressionLevel
+		zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(out, level)
+		})
+		return &zipArchiveWriter{zw: zw}, nil
+	}
+
+	compression, err := a.compressor()
+	if err != nil {
+		return nil, err
+	}
+	cw, err := compression.OpenWriter(w)
+	if err != nil {
+		return nil, err
+	}
+	tw := tar.NewWriter(cw)
+	return &tarArchiveWriter{tw: tw, closer: cw}, nil
+}
+
+// compressor returns the archives.Compression implementation backing a
+// tar-based Format, honoring CompressionLevel where the underlying
+// compressor supports one.
+func (a *Archive) compressor() (archives.Compression, error) {
+	switch a.Format {
+	case "", FormatTarGz:
+		return archives.Gzip{CompressionLevel: a.CompressionLevel}, nil
+	case FormatTarZstd:
+		// archives.Zstd has no bare CompressionLevel field; it configures
+		// the underlying klauspost/compress/zstd encoder through
+		// EncoderOptions instead. A zero CompressionLevel is left to the
+		// encoder's own default rather than forced through the translation.
+		if a.CompressionLevel == 0 {
+			return archives.Zstd{}, nil
+		}
+		level := zstd.EncoderLevelFromZstd(a.CompressionLevel)
+		return archives.Zstd{EncoderOptions: []zstd.EOption{zstd.WithEncoderLevel(level)}}, nil
+	case FormatTarXz:
+		// archives.Xz has no compression-level knob: the underlying xz
+		// library doesn't expose one, so CompressionLevel is a no-op here
+		// rather than silently accepting a value it can't honor.
+		return archives.Xz{}, nil
+	case FormatTarBz2:
+		// archives.Bz2 has no compression-level knob either: bzip2 has no
+		// concept of one in this library, so CompressionLevel is a no-op
+		// here too, same as FormatTarXz.
+		return archives.Bz2{}, nil
+	default:
+		return nil, newFilesystemError(ErrCodeUnknownArchive, nil)
+	}
+}
+
+type tarArchiveWriter struct {
+	tw     *tar.Writer
+	closer io.Closer
+}
+
+func (t *tarArchiveWriter) WriteHeader(relative string, info ufs.FileInfo) (io.Writer, error) {
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return nil, err
+	}
+	header.Name = relative
+	if err := t.tw.WriteHeader(header); err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return io.Discard, nil
+	}
+	return t.tw, nil
+}
+
+func (t *tarArchiveWriter) Close() error {
+	if err := t.tw.Close(); err != nil {
+		return err
+	}
+	return t.closer.Close()
+}
+
+type zipArchiveWriter struct {
+	zw *zip.Writer
+}
+
+func (z *zipArchiveWriter) WriteHeader(relative string, info ufs.FileInfo) (io.Writer, error) {
+	if info.IsDir() {
+		_, err := z.zw.CreateHeader(&zip.FileHeader{Name: relative + "/", Method: zip.Store})
+		return io.Discard, err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return nil, err
+	}
+	header.Name = relative
+	header.Method = zip.Deflate
+	return z.zw.CreateHeader(header)
+}
+
+func (z *zipArchiveWriter) Close() error {
+	return z.zw.Close()
+}
@@ -0,0 +1,91 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"path/filepath"
+
+	"emperror.dev/errors"
+	"github.com/mholt/archives"
+)
+
+// magicPrefix pairs a magic byte sequence with the archives.Format it
+// identifies, mirroring Docker's DetectCompression helper.
+type magicPrefix struct {
+	bytes  []byte
+	format archives.Format
+}
+
+// magicPrefixes is checked in order against the first few bytes of a file,
+// but only for self-sufficient formats: a match can be returned immediately
+// only when it alone is enough to know how to extract the file. Zip is the
+// only such format here. Gzip/bzip2/xz/zstd magic bytes are deliberately
+// excluded: those four prefixes match just as well on a bare compressed
+// stream (e.g. `file.txt.gz`) as they do on this codebase's actual default
+// output, a compressed *tar* (`archive-{date}.tar.gz`). Only
+// archives.Identify decompresses far enough in to tell those two apart and
+// return the composite archives.CompressedArchive (which implements
+// Extractor) rather than a bare archives.Compression that extractStream
+// would mistake for a single compressed file.
+var magicPrefixes = []magicPrefix{
+	{bytes: []byte{0x50, 0x4b, 0x03, 0x04}, format: archives.Zip{}},
+}
+
+// identifyMagic returns the archives.Format matching the leading bytes of
+// header, or nil if none of the known self-sufficient magic sequences
+// match.
+func identifyMagic(header []byte) archives.Format {
+	for _, m := range magicPrefixes {
+		if bytes.HasPrefix(header, m.bytes) {
+			return m.format
+		}
+	}
+	return nil
+}
+
+// IdentifyArchive determines the archives.Format of the file at p. Self-
+// sufficient formats (currently just zip) are recognized from their magic
+// bytes directly, the same way Docker's DetectCompression sniffs a header;
+// everything else falls back to archives.Identify, which decompresses far
+// enough into the stream to tell a bare compressed file apart from a
+// compressed tar. The file is opened once and returned seeked back to its
+// start, so callers that go on to read the archive (rather than just
+// reporting its format) need not open it again.
+func (fs *Filesystem) IdentifyArchive(ctx context.Context, p string) (archives.Format, io.ReadSeekCloser, error) {
+	f, err := fs.unixFS.Open(p)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	header := make([]byte, 262) // longest prefix archives.Identify itself inspects
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		_ = f.Close()
+		return nil, nil, err
+	}
+	header = header[:n]
+
+	if format := identifyMagic(header); format != nil {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			_ = f.Close()
+			return nil, nil, err
+		}
+		return format, f, nil
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, nil, err
+	}
+	format, _, err := archives.Identify(ctx, filepath.Base(p), f)
+	if err != nil && !errors.Is(err, archives.NoMatch) {
+		_ = f.Close()
+		return nil, nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, nil, err
+	}
+	return format, f, nil
+}
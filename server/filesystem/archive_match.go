@@ -0,0 +1,50 @@
+package filesystem
+
+import (
+	"strings"
+
+	ignore "github.com/sabhiram/go-gitignore"
+)
+
+// pathMatcher reports whether a given archive-relative path should be kept.
+// It is shared between Archive's Exclude list and the
+// extractStreamOptions Include/Exclude pair so both sides of a compress or
+// decompress operation interpret patterns the same, gitignore-like way that
+// Filesystem.IsIgnored uses for `.pteroignore`.
+type pathMatcher func(relative string) bool
+
+// compileMatcher builds a pathMatcher from an optional include allow-list and
+// an optional gitignore-style exclude list. A nil/empty include list means
+// "everything is included"; a nil/empty exclude list means "nothing is
+// excluded".
+func compileMatcher(include, exclude []string) (pathMatcher, error) {
+	var excluded *ignore.GitIgnore
+	if len(exclude) > 0 {
+		m, err := ignore.CompileIgnoreLines(exclude...)
+		if err != nil {
+			return nil, err
+		}
+		excluded = m
+	}
+	return func(relative string) bool {
+		if len(include) > 0 && !matchesInclude(include, relative) {
+			return false
+		}
+		if excluded != nil && excluded.MatchesPath(relative) {
+			return false
+		}
+		return true
+	}, nil
+}
+
+// matchesInclude reports whether relative is, or is nested within, one of
+// the entries in include.
+func matchesInclude(include []string, relative string) bool {
+	for _, p := range include {
+		p = strings.Trim(p, "/")
+		if relative == p || strings.HasPrefix(relative, p+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package filesystem
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+)
+
+func TestDecompressionSession(t *testing.T) {
+	g := Goblin(t)
+	fs, _ := NewFs()
+
+	g.Describe("DecompressionSession", func() {
+		g.AfterEach(func() {
+			_ = fs.TruncateRootDirectory()
+		})
+
+		g.It("does not checkpoint to disk before sessionCheckpointEntries or sessionCheckpointInterval elapse", func() {
+			s, err := fs.loadOrCreateSession("/", "archive.tar.gz")
+			g.Assert(err).IsNil()
+
+			g.Assert(s.markComplete("a.txt", 1)).IsNil()
+			g.Assert(s.isComplete("a.txt")).IsTrue()
+
+			// A single completion, well under the checkpoint threshold and
+			// interval, should not have touched the sidecar file yet.
+			_, err = fs.unixFS.Stat(s.path)
+			g.Assert(err).IsNotNil()
+		})
+
+		g.It("checkpoints once sessionCheckpointEntries completions accumulate", func() {
+			s, err := fs.loadOrCreateSession("/", "archive.tar.gz")
+			g.Assert(err).IsNil()
+
+			for i := 0; i < sessionCheckpointEntries; i++ {
+				g.Assert(s.markComplete("file-"+strconv.Itoa(i)+".txt", 1)).IsNil()
+			}
+
+			info, err := fs.unixFS.Stat(s.path)
+			g.Assert(err).IsNil()
+			g.Assert(info.Size() > 0).IsTrue()
+		})
+
+		g.It("checkpoints once sessionCheckpointInterval elapses, even with few entries", func() {
+			s, err := fs.loadOrCreateSession("/", "archive.tar.gz")
+			g.Assert(err).IsNil()
+			s.lastFlush = time.Now().Add(-2 * sessionCheckpointInterval)
+
+			g.Assert(s.markComplete("a.txt", 1)).IsNil()
+
+			_, err = fs.unixFS.Stat(s.path)
+			g.Assert(err).IsNil()
+		})
+
+		g.It("resumes from a previously checkpointed sidecar", func() {
+			s, err := fs.loadOrCreateSession("/", "archive.tar.gz")
+			g.Assert(err).IsNil()
+			s.lastFlush = time.Now().Add(-2 * sessionCheckpointInterval)
+			g.Assert(s.markComplete("a.txt", 5)).IsNil()
+
+			resumed, err := fs.loadOrCreateSession("/", "archive.tar.gz")
+			g.Assert(err).IsNil()
+			g.Assert(resumed.isComplete("a.txt")).IsTrue()
+			g.Assert(resumed.BytesWritten).Equal(int64(5))
+		})
+	})
+}
@@ -0,0 +1,36 @@
+package filesystem
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/franela/goblin"
+)
+
+func TestReadSpillable(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("readSpillable", func() {
+		g.It("keeps small contents in memory", func() {
+			content := "hello, world!\n"
+			buf, spillPath, err := readSpillable(strings.NewReader(content), 4096)
+			g.Assert(err).IsNil()
+			g.Assert(spillPath).Equal("")
+			g.Assert(string(buf)).Equal(content)
+		})
+
+		g.It("spills contents past spillThreshold to a temporary file", func() {
+			content := strings.Repeat("a", spillThreshold+1)
+			buf, spillPath, err := readSpillable(strings.NewReader(content), 4096)
+			g.Assert(err).IsNil()
+			g.Assert(buf).IsNil()
+			g.Assert(spillPath != "").IsTrue()
+			defer os.Remove(spillPath)
+
+			got, err := os.ReadFile(spillPath)
+			g.Assert(err).IsNil()
+			g.Assert(string(got)).Equal(content)
+		})
+	})
+}
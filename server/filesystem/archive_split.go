@@ -0,0 +1,164 @@
+package filesystem
+
+import (
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/pterodactyl/wings/internal/ufs"
+)
+
+// splitWriter is an io.WriteCloser that spreads its output across a
+// sequence of numbered part files once the configured size threshold is
+// exceeded, so a single archive can stay under per-file size limits imposed
+// by object storage and some FTP clients. Parts are named
+// `<base>.part001.<ext>`, `<base>.part002.<ext>`, and so on.
+type splitWriter struct {
+	fs   *Filesystem
+	dir  string
+	base string
+	ext  string
+	// limit is the maximum number of bytes written to a single part before
+	// rolling over to the next one. A limit of zero disables splitting.
+	limit int64
+
+	part    int
+	written int64
+	total   int64
+	file    ufs.File
+	current *ufs.CountedWriter
+
+	// parts records the destination path of every part created, in order,
+	// so the caller can stat the first one or clean up on failure.
+	parts []string
+}
+
+// newSplitWriter creates a splitWriter that writes parts of base.ext into
+// dir, rolling over once a part reaches limit bytes.
+func newSplitWriter(fs *Filesystem, dir, base, ext string, limit int64) (*splitWriter, error) {
+	sw := &splitWriter{fs: fs, dir: dir, base: base, ext: ext, limit: limit}
+	if err := sw.rollover(); err != nil {
+		return nil, err
+	}
+	return sw, nil
+}
+
+func (s *splitWriter) partName() string {
+	return fmt.Sprintf("%s.part%03d.%s", s.base, s.part, s.ext)
+}
+
+func (s *splitWriter) rollover() error {
+	if s.file != nil {
+		if err := s.file.Close(); err != nil {
+			return err
+		}
+	}
+	s.part++
+	p := path.Join(s.dir, s.partName())
+	f, err := s.fs.unixFS.OpenFile(p, ufs.O_WRONLY|ufs.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	s.file = f
+	s.current = ufs.NewCountedWriter(f)
+	s.written = 0
+	s.parts = append(s.parts, p)
+	return nil
+}
+
+// Write implements io.Writer, rolling over to a new part whenever the
+// current one reaches limit. A single call writes p in limit-sized (or
+// smaller) slices rather than handing the whole thing to the current part,
+// so one large Write (e.g. a whole file's contents, as streamParallel
+// produces) can still be split across multiple parts instead of blowing one
+// part past limit.
+func (s *splitWriter) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		if s.limit > 0 && s.written >= s.limit {
+			if err := s.rollover(); err != nil {
+				return written, err
+			}
+		}
+		chunk := p
+		if s.limit > 0 {
+			if remaining := s.limit - s.written; int64(len(chunk)) > remaining {
+				chunk = chunk[:remaining]
+			}
+		}
+		n, err := s.current.Write(chunk)
+		written += n
+		s.written += int64(n)
+		s.total += int64(n)
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// Close closes the currently open part. It does not remove any parts.
+func (s *splitWriter) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
+
+// BytesWritten returns the total number of bytes written across all parts.
+func (s *splitWriter) BytesWritten() int64 {
+	return s.total
+}
+
+// FirstPartInfo stats the first part written, which is what CompressFiles
+// reports back to callers.
+func (s *splitWriter) FirstPartInfo() (ufs.FileInfo, error) {
+	return s.fs.unixFS.Stat(s.parts[0])
+}
+
+// RemoveAll removes every part written so far, used when an archive turns
+// out to exceed the disk quota after the fact.
+func (s *splitWriter) RemoveAll() {
+	for _, p := range s.parts {
+		_ = s.fs.unixFS.Remove(p)
+	}
+}
+
+// multipartReader concatenates a sequence of part files into a single
+// io.Reader, in order, so a split archive can be identified and decompressed
+// as if it were one contiguous stream.
+type multipartReader struct {
+	readers []io.Reader
+	closers []io.Closer
+	mr      io.Reader
+}
+
+func (fs *Filesystem) newMultipartReader(dir string, parts []string) (*multipartReader, error) {
+	mr := &multipartReader{}
+	for _, name := range parts {
+		f, err := fs.unixFS.Open(path.Join(dir, name))
+		if err != nil {
+			_ = mr.Close()
+			return nil, err
+		}
+		mr.readers = append(mr.readers, f)
+		mr.closers = append(mr.closers, f)
+	}
+	mr.mr = io.MultiReader(mr.readers...)
+	return mr, nil
+}
+
+func (mr *multipartReader) Read(p []byte) (int, error) {
+	return mr.mr.Read(p)
+}
+
+func (mr *multipartReader) Close() error {
+	var err error
+	for _, c := range mr.closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,62 @@
+package filesystem
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/franela/goblin"
+)
+
+func TestSplitWriter(t *testing.T) {
+	g := Goblin(t)
+	fs, _ := NewFs()
+
+	g.Describe("splitWriter", func() {
+		g.AfterEach(func() {
+			_ = fs.TruncateRootDirectory()
+		})
+
+		g.It("rolls over mid-Write so no part exceeds the limit", func() {
+			sw, err := newSplitWriter(fs, "/", "archive", "tar.gz", 10)
+			g.Assert(err).IsNil()
+
+			// A single Write larger than the limit must still be split across
+			// multiple parts rather than overshooting the first one.
+			n, err := sw.Write([]byte(strings.Repeat("a", 25)))
+			g.Assert(err).IsNil()
+			g.Assert(n).Equal(25)
+			g.Assert(sw.Close()).IsNil()
+
+			g.Assert(len(sw.parts)).Equal(3)
+			for _, p := range sw.parts[:len(sw.parts)-1] {
+				info, err := fs.unixFS.Stat(p)
+				g.Assert(err).IsNil()
+				g.Assert(info.Size() <= 10).IsTrue()
+			}
+		})
+
+		g.It("reassembles split parts back into the original stream", func() {
+			sw, err := newSplitWriter(fs, "/", "archive", "tar.gz", 8)
+			g.Assert(err).IsNil()
+			_, err = sw.Write([]byte("hello, world! this is a multipart test\n"))
+			g.Assert(err).IsNil()
+			g.Assert(sw.Close()).IsNil()
+
+			mr, err := fs.newMultipartReader("/", sw.parts)
+			g.Assert(err).IsNil()
+			defer mr.Close()
+
+			var sb strings.Builder
+			buf := make([]byte, 4096)
+			for {
+				n, err := mr.Read(buf)
+				sb.Write(buf[:n])
+				if err != nil {
+					break
+				}
+			}
+
+			g.Assert(sb.String()).Equal("hello, world! this is a multipart test\n")
+		})
+	})
+}
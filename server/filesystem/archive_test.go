@@ -87,6 +87,188 @@ func TestArchive_Stream(t *testing.T) {
 	})
 }
 
+func TestArchive_Stream_Exclude(t *testing.T) {
+	g := Goblin(t)
+	fs, rfs := NewFs()
+
+	g.Describe("Archive", func() {
+		g.AfterEach(func() {
+			_ = fs.TruncateRootDirectory()
+		})
+
+		g.It("omits files matching Exclude even though they matched Files", func() {
+			g.Assert(fs.CreateDirectory("test", "/")).IsNil()
+
+			r := strings.NewReader("hello, world!\n")
+			g.Assert(fs.Write("test/keep.txt", r, r.Size(), 0o644)).IsNil()
+
+			r = strings.NewReader("hello, world!\n")
+			g.Assert(fs.Write("test/skip.log", r, r.Size(), 0o644)).IsNil()
+
+			a := &Archive{
+				Filesystem: fs,
+				Files:      []string{"test"},
+				Exclude:    []string{"*.log"},
+			}
+
+			archivePath := filepath.Join(rfs.root, "archive.tar.gz")
+			g.Assert(a.Create(context.Background(), archivePath)).IsNil()
+
+			genericFs, err := archives.FileSystem(context.Background(), archivePath, nil)
+			g.Assert(err).IsNil()
+			afs, ok := genericFs.(iofs.ReadDirFS)
+			g.Assert(ok).IsTrue()
+
+			files, err := getFiles(afs, ".")
+			g.Assert(err).IsNil()
+			g.Assert(files).Equal([]string{"test/keep.txt"})
+		})
+	})
+}
+
+func TestArchive_Stream_Parallel(t *testing.T) {
+	g := Goblin(t)
+	fs, rfs := NewFs()
+
+	g.Describe("Archive", func() {
+		g.AfterEach(func() {
+			_ = fs.TruncateRootDirectory()
+		})
+
+		g.It("produces the same entries as the serial path, in discovery order", func() {
+			g.Assert(fs.CreateDirectory("test", "/")).IsNil()
+			for _, name := range []string{"test/a.txt", "test/b.txt", "test/c.txt"} {
+				r := strings.NewReader("contents of " + name)
+				g.Assert(fs.Write(name, r, r.Size(), 0o644)).IsNil()
+			}
+
+			a := &Archive{
+				Filesystem:  fs,
+				Files:       []string{"test"},
+				Concurrency: 4,
+			}
+
+			archivePath := filepath.Join(rfs.root, "archive-parallel.tar.gz")
+			g.Assert(a.Create(context.Background(), archivePath)).IsNil()
+
+			genericFs, err := archives.FileSystem(context.Background(), archivePath, nil)
+			g.Assert(err).IsNil()
+			afs, ok := genericFs.(iofs.ReadDirFS)
+			g.Assert(ok).IsTrue()
+
+			files, err := getFiles(afs, ".")
+			g.Assert(err).IsNil()
+
+			expected := []string{"test/a.txt", "test/b.txt", "test/c.txt"}
+			sort.Strings(files)
+			g.Assert(files).Equal(expected)
+		})
+	})
+}
+
+func TestArchive_Stream_Format(t *testing.T) {
+	g := Goblin(t)
+	fs, rfs := NewFs()
+
+	g.Describe("Archive", func() {
+		g.AfterEach(func() {
+			_ = fs.TruncateRootDirectory()
+		})
+
+		g.It("writes a zip archive when Format is FormatZip", func() {
+			r := strings.NewReader("hello, world!\n")
+			g.Assert(fs.Write("file.txt", r, r.Size(), 0o644)).IsNil()
+
+			a := &Archive{
+				Filesystem: fs,
+				Files:      []string{"file.txt"},
+				Format:     FormatZip,
+			}
+
+			archivePath := filepath.Join(rfs.root, "archive.zip")
+			g.Assert(a.Create(context.Background(), archivePath)).IsNil()
+
+			genericFs, err := archives.FileSystem(context.Background(), archivePath, nil)
+			g.Assert(err).IsNil()
+			afs, ok := genericFs.(iofs.ReadDirFS)
+			g.Assert(ok).IsTrue()
+
+			files, err := getFiles(afs, ".")
+			g.Assert(err).IsNil()
+			g.Assert(files).Equal([]string{"file.txt"})
+		})
+
+		formats := []struct {
+			name string
+			f    Format
+		}{
+			{"FormatTarZstd", FormatTarZstd},
+			{"FormatTarXz", FormatTarXz},
+			{"FormatTarBz2", FormatTarBz2},
+		}
+		for _, tc := range formats {
+			tc := tc
+			g.It("round-trips a tarball compressed with "+tc.name, func() {
+				r := strings.NewReader("hello, world!\n")
+				g.Assert(fs.Write("file.txt", r, r.Size(), 0o644)).IsNil()
+
+				a := &Archive{
+					Filesystem:       fs,
+					Files:            []string{"file.txt"},
+					Format:           tc.f,
+					CompressionLevel: 1,
+				}
+
+				archivePath := filepath.Join(rfs.root, "archive."+tc.f.Extension())
+				g.Assert(a.Create(context.Background(), archivePath)).IsNil()
+
+				genericFs, err := archives.FileSystem(context.Background(), archivePath, nil)
+				g.Assert(err).IsNil()
+				afs, ok := genericFs.(iofs.ReadDirFS)
+				g.Assert(ok).IsTrue()
+
+				files, err := getFiles(afs, ".")
+				g.Assert(err).IsNil()
+				g.Assert(files).Equal([]string{"file.txt"})
+			})
+		}
+	})
+}
+
+func TestIdentifyArchive_TarGz(t *testing.T) {
+	g := Goblin(t)
+	fs, rfs := NewFs()
+
+	g.Describe("IdentifyArchive", func() {
+		g.AfterEach(func() {
+			_ = fs.TruncateRootDirectory()
+		})
+
+		g.It("recognizes a tar.gz as an Extractor, not a bare Compression", func() {
+			// Regression test: the magic bytes for gzip also match a bare
+			// compressed file, not just a compressed tar. If IdentifyArchive
+			// ever returns a bare archives.Compression for one of this
+			// codebase's own tar.gz backups, extraction would decompress the
+			// whole archive into a single file instead of walking its
+			// members.
+			g.Assert(fs.CreateDirectory("test", "/")).IsNil()
+			r := strings.NewReader("hello, world!\n")
+			g.Assert(fs.Write("test/file.txt", r, r.Size(), 0o644)).IsNil()
+
+			a := &Archive{Filesystem: fs, Files: []string{"test"}}
+			archivePath := filepath.Join(rfs.root, "archive.tar.gz")
+			g.Assert(a.Create(context.Background(), archivePath)).IsNil()
+
+			format, rc, err := fs.IdentifyArchive(context.Background(), "archive.tar.gz")
+			g.Assert(err).IsNil()
+			defer rc.Close()
+
+			_, ok := format.(archives.Extractor)
+			g.Assert(ok).IsTrue()
+		})
+	})
+}
+
 func getFiles(f iofs.ReadDirFS, name string) ([]string, error) {
 	var v []string
 
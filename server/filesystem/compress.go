@@ -19,6 +19,34 @@ import (
 	"github.com/pterodactyl/wings/server/filesystem/archiverext"
 )
 
+// CompressOptions configures a CompressFiles call. The zero value compresses
+// serially into a single tar.gz with no excludes, matching the historical
+// behavior of CompressFiles before these options existed.
+type CompressOptions struct {
+	// Format selects the container/compression the archive is written as.
+	// The zero value is FormatTarGz.
+	Format Format
+	// CompressionLevel is passed through to the underlying compressor; see
+	// Archive.CompressionLevel.
+	CompressionLevel int
+	// SplitSize, if greater than zero, writes output as
+	// `archive-{date}.part001.<ext>`, `part002`, ..., starting the next part
+	// once the current part reaches that many bytes.
+	SplitSize int64
+	// Exclude is a list of gitignore/.pteroignore-style glob patterns,
+	// relative to dir, for files and directories to skip.
+	Exclude []string
+	// Concurrency is the number of worker goroutines used to read files from
+	// disk in parallel. Zero or negative reads serially.
+	Concurrency int
+	// BufferCapacity is the number of entries buffered in the parallel
+	// pipeline. Defaults to Concurrency when unset.
+	BufferCapacity int
+	// ChunkSize is the read buffer size, in bytes, used by each parallel
+	// worker. Defaults to 4 KiB.
+	ChunkSize int
+}
+
 // CompressFiles compresses all the files matching the given paths in the
 // specified directory. This function also supports passing nested paths to only
 // compress certain files and folders when working in a larger directory. This
@@ -27,13 +55,47 @@ import (
 //
 // All paths are relative to the dir that is passed in as the first argument,
 // and the compressed file will be placed at that location named
-// `archive-{date}.tar.gz`.
-func (fs *Filesystem) CompressFiles(dir string, paths []string) (ufs.FileInfo, error) {
-	a := &Archive{Filesystem: fs, BaseDirectory: dir, Files: paths}
-	d := path.Join(
-		dir,
-		fmt.Sprintf("archive-%s.tar.gz", strings.ReplaceAll(time.Now().Format(time.RFC3339), ":", "")),
-	)
+// `archive-{date}.<ext>`, with the extension determined by opts.Format. See
+// CompressOptions for the rest of the knobs this accepts; opts.Exclude can
+// additionally skip files and folders inside the allow-list. When opts.SplitSize
+// is set, the ufs.FileInfo returned describes only the first part.
+//
+// opts is variadic so existing callers written before CompressOptions
+// existed keep compiling unchanged; only the first value, if any, is used.
+func (fs *Filesystem) CompressFiles(dir string, paths []string, opts ...CompressOptions) (ufs.FileInfo, error) {
+	opt := firstCompressOptions(opts)
+	a := &Archive{
+		Filesystem:       fs,
+		BaseDirectory:    dir,
+		Files:            paths,
+		Exclude:          opt.Exclude,
+		Format:           opt.Format,
+		CompressionLevel: opt.CompressionLevel,
+		SplitSize:        opt.SplitSize,
+		Concurrency:      opt.Concurrency,
+		BufferCapacity:   opt.BufferCapacity,
+		ChunkSize:        opt.ChunkSize,
+	}
+	base := fmt.Sprintf("archive-%s", strings.ReplaceAll(time.Now().Format(time.RFC3339), ":", ""))
+
+	if a.SplitSize > 0 {
+		sw, err := newSplitWriter(fs, dir, base, a.Format.Extension(), a.SplitSize)
+		if err != nil {
+			return nil, err
+		}
+		defer sw.Close()
+		if err := a.Stream(context.Background(), sw); err != nil {
+			return nil, err
+		}
+		if !fs.unixFS.CanFit(sw.BytesWritten()) {
+			sw.RemoveAll()
+			return nil, newFilesystemError(ErrCodeDiskSpace, nil)
+		}
+		fs.unixFS.Add(sw.BytesWritten())
+		return sw.FirstPartInfo()
+	}
+
+	d := path.Join(dir, fmt.Sprintf("%s.%s", base, a.Format.Extension()))
 	f, err := fs.unixFS.OpenFile(d, ufs.O_WRONLY|ufs.O_CREATE, 0o644)
 	if err != nil {
 		return nil, err
@@ -51,41 +113,58 @@ func (fs *Filesystem) CompressFiles(dir string, paths []string) (ufs.FileInfo, e
 	return f.Stat()
 }
 
-func (fs *Filesystem) archiverFileSystem(ctx context.Context, p string) (iofs.FS, error) {
-	f, err := fs.unixFS.Open(p)
+// DecompressMultipart stitches the numbered parts of a split archive
+// (produced by CompressFiles with a SplitSize) back into a single stream and
+// decompresses it as if it were one contiguous archive. parts must be given
+// in the order they should be concatenated.
+func (fs *Filesystem) DecompressMultipart(ctx context.Context, dir string, parts []string) error {
+	mr, err := fs.newMultipartReader(dir, parts)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	// Do not use defer to close `f`, it will likely be used later.
+	defer mr.Close()
 
-	format, _, err := archives.Identify(ctx, filepath.Base(p), f)
-	if err != nil && !errors.Is(err, archives.NoMatch) {
-		_ = f.Close()
-		return nil, err
+	format, input, err := archives.Identify(ctx, parts[0], mr)
+	if err != nil {
+		if errors.Is(err, archives.NoMatch) {
+			return newFilesystemError(ErrCodeUnknownArchive, err)
+		}
+		return err
 	}
+	return fs.extractStream(ctx, extractStreamOptions{
+		FileName:  parts[0],
+		Directory: dir,
+		Format:    format,
+		Reader:    input,
+	})
+}
 
-	// Reset the file reader.
-	if _, err := f.Seek(0, io.SeekStart); err != nil {
-		_ = f.Close()
+func (fs *Filesystem) archiverFileSystem(ctx context.Context, p string) (iofs.FS, error) {
+	format, f, err := fs.IdentifyArchive(ctx, p)
+	if err != nil && !errors.Is(err, archives.NoMatch) {
 		return nil, err
 	}
+	// Do not use defer to close `f`, it will likely be used later.
 
-	info, err := f.Stat()
+	info, err := fs.unixFS.Stat(p)
 	if err != nil {
 		_ = f.Close()
 		return nil, err
 	}
 
 	if format != nil {
+		// f is backed by a regular on-disk file, so it always also
+		// implements io.ReaderAt; the interfaces below just don't say so.
+		ra := f.(io.ReaderAt)
 		switch ff := format.(type) {
 		case archives.Zip:
 			// zip.Reader is more performant than ArchiveFS, because zip.Reader caches content information
 			// and zip.Reader can open several content files concurrently because of io.ReaderAt requirement
 			// while ArchiveFS can't.
 			// zip.Reader doesn't suffer from issue #330 and #310 according to local test (but they should be fixed anyway)
-			return zip.NewReader(f, info.Size())
+			return zip.NewReader(ra, info.Size())
 		case archives.Archival:
-			return archives.ArchiveFS{Stream: io.NewSectionReader(f, 0, info.Size()), Format: ff, Context: ctx}, nil
+			return archives.ArchiveFS{Stream: io.NewSectionReader(ra, 0, info.Size()), Format: ff, Context: ctx}, nil
 		case archives.Compression:
 			return archiverext.FileFS{File: f, Compression: ff}, nil
 		}
@@ -134,37 +213,82 @@ func (fs *Filesystem) SpaceAvailableForDecompression(ctx context.Context, dir st
 	})
 }
 
+// DecompressOptions configures a DecompressFile or ExtractStreamUnsafe call.
+type DecompressOptions struct {
+	// Include, if non-empty, restricts extraction to entries at or below one
+	// of these archive-relative paths. Mirrors Docker's
+	// TarOptions.IncludeFiles.
+	Include []string
+	// Exclude is a gitignore-style list of archive-relative patterns to skip
+	// during extraction. Mirrors Docker's TarOptions.ExcludePatterns.
+	Exclude []string
+	// Resume, if true, persists a DecompressionSession sidecar next to the
+	// archive so that a crash mid-extraction can be resumed later without
+	// re-extracting entries that already landed on disk. Only honored by
+	// DecompressFile, since ExtractStreamUnsafe has no stable archive path
+	// to key the sidecar off of.
+	Resume bool
+	// OnProgress, if set, is called after each entry finishes extracting.
+	OnProgress ProgressFunc
+}
+
 // DecompressFile will decompress a file in a given directory by using the
 // archiver tool to infer the file type and go from there. This will walk over
 // all the files within the given archive and ensure that there is not a
 // zip-slip attack being attempted by validating that the final path is within
 // the server data directory.
-func (fs *Filesystem) DecompressFile(ctx context.Context, dir string, file string) error {
-	f, err := fs.unixFS.Open(filepath.Join(dir, file))
-	if err != nil {
-		return err
-	}
-	defer f.Close()
+//
+// opts is variadic so existing callers written before DecompressOptions
+// existed keep compiling unchanged; only the first value, if any, is used.
+func (fs *Filesystem) DecompressFile(ctx context.Context, dir string, file string, opts ...DecompressOptions) error {
+	opt := firstDecompressOptions(opts)
 
-	// Identify the type of archive we are dealing with.
-	format, input, err := archives.Identify(ctx, filepath.Base(file), f)
+	// Identify the type of archive we are dealing with, sniffing magic bytes
+	// before falling back to extension-based detection.
+	format, input, err := fs.IdentifyArchive(ctx, filepath.Join(dir, file))
 	if err != nil {
 		if errors.Is(err, archives.NoMatch) {
 			return newFilesystemError(ErrCodeUnknownArchive, err)
 		}
 		return err
 	}
+	defer input.Close()
+	if format == nil {
+		return newFilesystemError(ErrCodeUnknownArchive, archives.NoMatch)
+	}
 
-	return fs.extractStream(ctx, extractStreamOptions{
-		FileName:  file,
-		Directory: dir,
-		Format:    format,
-		Reader:    input,
-	})
+	var session *DecompressionSession
+	if opt.Resume {
+		session, err = fs.loadOrCreateSession(dir, file)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := fs.extractStream(ctx, extractStreamOptions{
+		FileName:   file,
+		Directory:  dir,
+		Format:     format,
+		Reader:     input,
+		Include:    opt.Include,
+		Exclude:    opt.Exclude,
+		Session:    session,
+		OnProgress: opt.OnProgress,
+	}); err != nil {
+		return err
+	}
+	if session != nil {
+		return session.Close()
+	}
+	return nil
 }
 
 // ExtractStreamUnsafe .
-func (fs *Filesystem) ExtractStreamUnsafe(ctx context.Context, dir string, r io.Reader) error {
+//
+// opts is variadic so existing callers written before DecompressOptions
+// existed keep compiling unchanged; only the first value, if any, is used.
+func (fs *Filesystem) ExtractStreamUnsafe(ctx context.Context, dir string, r io.Reader, opts ...DecompressOptions) error {
+	opt := firstDecompressOptions(opts)
 	format, input, err := archives.Identify(ctx, "archive.tar.gz", r)
 	if err != nil {
 		if errors.Is(err, archives.NoMatch) {
@@ -173,12 +297,35 @@ func (fs *Filesystem) ExtractStreamUnsafe(ctx context.Context, dir string, r io.
 		return err
 	}
 	return fs.extractStream(ctx, extractStreamOptions{
-		Directory: dir,
-		Format:    format,
-		Reader:    input,
+		Directory:  dir,
+		Format:     format,
+		Reader:     input,
+		Include:    opt.Include,
+		Exclude:    opt.Exclude,
+		OnProgress: opt.OnProgress,
 	})
 }
 
+// firstCompressOptions returns the first element of opts, or the zero value
+// if empty, so CompressFiles can accept a variadic opts parameter without
+// every call site needing a nil check.
+func firstCompressOptions(opts []CompressOptions) CompressOptions {
+	if len(opts) == 0 {
+		return CompressOptions{}
+	}
+	return opts[0]
+}
+
+// firstDecompressOptions returns the first element of opts, or the zero
+// value if empty, so DecompressFile and ExtractStreamUnsafe can accept a
+// variadic opts parameter without every call site needing a nil check.
+func firstDecompressOptions(opts []DecompressOptions) DecompressOptions {
+	if len(opts) == 0 {
+		return DecompressOptions{}
+	}
+	return opts[0]
+}
+
 type extractStreamOptions struct {
 	// The directory to extract the archive to.
 	Directory string
@@ -188,6 +335,18 @@ type extractStreamOptions struct {
 	Format archives.Format
 	// Reader for the archive.
 	Reader io.Reader
+	// Include, if non-empty, restricts extraction to entries at or below one
+	// of these archive-relative paths. Mirrors Docker's
+	// TarOptions.IncludeFiles.
+	Include []string
+	// Exclude is a gitignore-style list of archive-relative patterns to skip
+	// during extraction. Mirrors Docker's TarOptions.ExcludePatterns.
+	Exclude []string
+	// Session, if set, is consulted to skip entries already extracted by a
+	// previous attempt and updated as new entries complete.
+	Session *DecompressionSession
+	// OnProgress, if set, is called after each entry finishes extracting.
+	OnProgress ProgressFunc
 }
 
 func (fs *Filesystem) extractStream(ctx context.Context, opts extractStreamOptions) error {
@@ -253,14 +412,37 @@ func (fs *Filesystem) extractStream(ctx context.Context, opts extractStreamOptio
 			}
 		}
 
+		if opts.OnProgress != nil {
+			info, err := f.Stat()
+			if err == nil {
+				opts.OnProgress(Progress{BytesWritten: info.Size(), CurrentFile: filepath.Base(p), FilesDone: 1, FilesTotal: 1})
+			}
+		}
+
 		return nil
 	}
 
+	allowed, err := compileMatcher(opts.Include, opts.Exclude)
+	if err != nil {
+		return err
+	}
+
+	var filesDone int
+	var bytesWritten int64
 	// Decompress and extract archive
 	return ex.Extract(ctx, opts.Reader, func(ctx context.Context, f archives.FileInfo) error {
 		if f.IsDir() {
 			return nil
 		}
+		if !allowed(f.NameInArchive) {
+			return nil
+		}
+		if opts.Session != nil && opts.Session.isComplete(f.NameInArchive) {
+			// Already extracted by a previous, interrupted attempt; its
+			// bytes are already accounted for on disk, so skip it entirely
+			// rather than re-writing (and re-counting quota for) it.
+			return nil
+		}
 		p := filepath.Join(opts.Directory, f.NameInArchive)
 		// If it is ignored, just don't do anything with the file and skip over it.
 		if err := fs.IsIgnored(p); err != nil {
@@ -278,6 +460,16 @@ func (fs *Filesystem) extractStream(ctx context.Context, opts extractStreamOptio
 		if err := fs.Chtimes(p, f.ModTime(), f.ModTime()); err != nil {
 			return wrapError(err, opts.FileName)
 		}
+		if opts.Session != nil {
+			if err := opts.Session.markComplete(f.NameInArchive, f.Size()); err != nil {
+				return wrapError(err, opts.FileName)
+			}
+		}
+		filesDone++
+		bytesWritten += f.Size()
+		if opts.OnProgress != nil {
+			opts.OnProgress(Progress{BytesWritten: bytesWritten, CurrentFile: f.NameInArchive, FilesDone: filesDone})
+		}
 		return nil
 	})
 }